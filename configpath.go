@@ -0,0 +1,218 @@
+// configpath.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+// This file resolves where vice's config file lives. Previously
+// LoadOrMakeDefaultConfig assumed an implicit, OS-specific path with no
+// way to override it; this adds a proper search path ($VICE_CONFIG_DIR,
+// then the platform user config directory, then the current working
+// directory, then the legacy path vice used to hard-code), a -config
+// flag to point at an arbitrary file, and a one-time migration that
+// copies a config found at the legacy location forward to the new
+// default so upgrading doesn't silently reset everyone's settings.
+//
+// Sector and position file paths stored in the config are resolved
+// against the config file's own directory (via resolveConfigRelative),
+// not the current working directory, so relative paths in a config
+// saved from one CWD still work when vice is launched from another.
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+const legacyConfigFileName = "vice.json"
+const configFileName = "config.json"
+const migratedMarkerName = ".migrated"
+
+// configDir is the directory the active config file was found in (or
+// created in); it's set by resolveConfigPath and used to resolve
+// relative sector/position file paths.
+var configDir string
+
+// configSearchPaths returns the ordered list of directories vice
+// searches for an existing config.json, from highest to lowest
+// priority. The legacy location is last: it's only consulted when
+// nothing has been found anywhere else, so that once a config has been
+// migrated forward it is the new location that's authoritative.
+func configSearchPaths() []string {
+	var paths []string
+
+	if dir := os.Getenv("VICE_CONFIG_DIR"); dir != "" {
+		paths = append(paths, dir)
+	}
+
+	if dir, err := userConfigDir(); err == nil {
+		paths = append(paths, dir)
+	}
+
+	if cwd, err := os.Getwd(); err == nil {
+		paths = append(paths, cwd)
+	}
+
+	if dir, err := legacyConfigDir(); err == nil {
+		paths = append(paths, dir)
+	}
+
+	return paths
+}
+
+// userConfigDir returns the platform-appropriate per-user config
+// directory for vice: $XDG_CONFIG_HOME/vice (or ~/.config/vice) on
+// Linux, ~/Library/Application Support/vice on macOS, and
+// %AppData%\vice on Windows.
+func userConfigDir() (string, error) {
+	switch runtime.GOOS {
+	case "darwin":
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(home, "Library", "Application Support", "vice"), nil
+
+	case "windows":
+		if appData := os.Getenv("AppData"); appData != "" {
+			return filepath.Join(appData, "vice"), nil
+		}
+		return "", fmt.Errorf("%%AppData%% is not set")
+
+	default:
+		base, err := os.UserConfigDir()
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(base, "vice"), nil
+	}
+}
+
+// legacyConfigDir returns the directory vice used to unconditionally
+// store its config file in, before this search path existed: the
+// user's home directory.
+func legacyConfigDir() (string, error) {
+	return os.UserHomeDir()
+}
+
+// resolveConfigPath decides which config file vice should load,
+// honoring an explicit -config path if one was given, otherwise walking
+// configSearchPaths() for the first directory that already has a
+// config.json, and falling back to the first (highest-priority)
+// candidate directory if none do. It also performs the one-time
+// migration from the legacy location. configDir is set as a side effect
+// so that sector/position file paths can be resolved relative to it.
+func resolveConfigPath(explicit string) (string, error) {
+	if explicit != "" {
+		configDir = filepath.Dir(explicit)
+		return explicit, nil
+	}
+
+	paths := configSearchPaths()
+	if len(paths) == 0 {
+		return "", fmt.Errorf("unable to determine a config directory")
+	}
+
+	legacyDir, legacyDirErr := legacyConfigDir()
+
+	// Only the non-legacy locations are a final answer here: the legacy
+	// directory is handled separately below, so that finding ~/vice.json
+	// in this loop doesn't short-circuit the migration this whole search
+	// path exists to perform.
+	for _, dir := range paths {
+		if legacyDirErr == nil && dir == legacyDir {
+			continue
+		}
+		candidate := filepath.Join(dir, configFileName)
+		if _, err := os.Stat(candidate); err == nil {
+			configDir = dir
+			return candidate, nil
+		}
+	}
+
+	// Nothing at any new-style location: migrate the legacy config
+	// forward if there is one, otherwise a fresh default will be
+	// created at the highest-priority location.
+	primary := paths[0]
+	if err := os.MkdirAll(primary, 0o755); err != nil {
+		return "", fmt.Errorf("%s: %w", primary, err)
+	}
+	target := filepath.Join(primary, configFileName)
+
+	if legacyDirErr == nil {
+		legacy := filepath.Join(legacyDir, legacyConfigFileName)
+		if err := migrateConfig(legacy, target); err != nil {
+			lg.Errorf(AlwaysCtx, "unable to migrate legacy config: %v", err)
+		}
+	}
+
+	configDir = primary
+	return target, nil
+}
+
+// migrateConfig copies a config file found at the legacy location
+// forward to target and drops a .migrated marker next to it, so this
+// only ever happens once even if the legacy file is left in place.
+func migrateConfig(legacy, target string) error {
+	marker := target + migratedMarkerName
+	if _, err := os.Stat(marker); err == nil {
+		return nil // already migrated
+	}
+
+	src, err := os.Open(legacy)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil // nothing to migrate
+		}
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	if _, err := io.Copy(dst, src); err != nil {
+		return err
+	}
+
+	lg.Printf(AlwaysCtx, "Migrated config from %s to %s", legacy, target)
+	return os.WriteFile(marker, []byte("migrated from "+legacy+"\n"), 0o644)
+}
+
+// resolveConfigRelative resolves a sector/position file path stored in
+// the config against the config file's own directory, rather than the
+// process's current working directory, so that a config saved from one
+// location still works if vice is later launched from somewhere else.
+// Absolute paths are returned unchanged.
+func resolveConfigRelative(path string) string {
+	if path == "" || filepath.IsAbs(path) || configDir == "" {
+		return path
+	}
+	return filepath.Join(configDir, path)
+}
+
+// printConfigPaths implements -print-config-paths: it prints the
+// search order configSearchPaths() uses along with which one (if any)
+// currently has a config file, to help users and bug reports pin down
+// which config vice is actually loading.
+func printConfigPaths() {
+	fmt.Println("vice config search path, in priority order:")
+	legacyDir, legacyDirErr := legacyConfigDir()
+	for _, dir := range configSearchPaths() {
+		name := configFileName
+		if legacyDirErr == nil && dir == legacyDir {
+			name = legacyConfigFileName
+		}
+		candidate := filepath.Join(dir, name)
+		status := fmt.Sprintf("(no %s)", name)
+		if _, err := os.Stat(candidate); err == nil {
+			status = "(found)"
+		}
+		fmt.Printf("  %s %s\n", candidate, status)
+	}
+}
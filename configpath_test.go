@@ -0,0 +1,220 @@
+// configpath_test.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	lg = NewLogger(false, false, 100)
+	os.Exit(m.Run())
+}
+
+func TestResolveConfigRelative(t *testing.T) {
+	old := configDir
+	defer func() { configDir = old }()
+
+	configDir = ""
+	if got := resolveConfigRelative("sectors/zab.sct"); got != "sectors/zab.sct" {
+		t.Errorf("with no configDir set, got %q, want unchanged path", got)
+	}
+
+	configDir = "/config"
+	if got := resolveConfigRelative(""); got != "" {
+		t.Errorf("empty path should be returned unchanged, got %q", got)
+	}
+	if got := resolveConfigRelative("/abs/zab.sct"); got != "/abs/zab.sct" {
+		t.Errorf("absolute path should be returned unchanged, got %q", got)
+	}
+	if want, got := filepath.Join("/config", "sectors/zab.sct"), resolveConfigRelative("sectors/zab.sct"); got != want {
+		t.Errorf("relative path: got %q, want %q", got, want)
+	}
+}
+
+// setupDirs points VICE_CONFIG_DIR, XDG_CONFIG_HOME, HOME, and the
+// current working directory at freshly created, empty temp directories,
+// so each test starts from a search path with nothing in it.
+func setupDirs(t *testing.T) (viceDir, xdgHome, home, cwd string) {
+	t.Helper()
+
+	viceDir = t.TempDir()
+	xdgHome = t.TempDir()
+	home = t.TempDir()
+	cwd = t.TempDir()
+
+	t.Setenv("VICE_CONFIG_DIR", viceDir)
+	t.Setenv("XDG_CONFIG_HOME", xdgHome)
+	t.Setenv("HOME", home)
+
+	oldCwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(cwd); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(oldCwd) })
+
+	return
+}
+
+func TestConfigSearchPathsOrder(t *testing.T) {
+	viceDir, xdgHome, home, cwd := setupDirs(t)
+
+	got := configSearchPaths()
+	want := []string{viceDir, filepath.Join(xdgHome, "vice"), cwd, home}
+	if len(got) != len(want) {
+		t.Fatalf("configSearchPaths() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("configSearchPaths()[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestResolveConfigPathExplicit(t *testing.T) {
+	old := configDir
+	defer func() { configDir = old }()
+
+	explicit := filepath.Join(t.TempDir(), "my-config.json")
+	path, err := resolveConfigPath(explicit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != explicit {
+		t.Errorf("resolveConfigPath(%q) = %q, want unchanged", explicit, path)
+	}
+	if configDir != filepath.Dir(explicit) {
+		t.Errorf("configDir = %q, want %q", configDir, filepath.Dir(explicit))
+	}
+}
+
+// TestResolveConfigPathMigratesOnFirstLaunch is the scenario the whole
+// search path exists for: an upgrading user with only ~/vice.json and
+// nothing yet at any new-style location must have it copied forward to
+// the highest-priority directory, with resolveConfigPath returning the
+// new location (not the legacy one) so the migration actually sticks on
+// every subsequent launch.
+func TestResolveConfigPathMigratesOnFirstLaunch(t *testing.T) {
+	viceDir, _, home, _ := setupDirs(t)
+	old := configDir
+	defer func() { configDir = old }()
+
+	legacy := filepath.Join(home, legacyConfigFileName)
+	contents := []byte(`{"activePosition":"ZAB_CTR"}`)
+	if err := os.WriteFile(legacy, contents, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	want := filepath.Join(viceDir, configFileName)
+	path, err := resolveConfigPath("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != want {
+		t.Errorf("resolveConfigPath(\"\") = %q, want %q", path, want)
+	}
+	if configDir != viceDir {
+		t.Errorf("configDir = %q, want %q", configDir, viceDir)
+	}
+
+	got, err := os.ReadFile(want)
+	if err != nil {
+		t.Fatalf("migrated config was not written: %v", err)
+	}
+	if string(got) != string(contents) {
+		t.Errorf("migrated config = %q, want %q", got, contents)
+	}
+
+	// A second launch must keep returning the migrated location, not
+	// fall back to the legacy file that's still sitting in $HOME.
+	path, err = resolveConfigPath("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != want {
+		t.Errorf("second resolveConfigPath(\"\") = %q, want %q", path, want)
+	}
+}
+
+// TestResolveConfigPathPrefersNewLocation confirms that once a config
+// has already been migrated (or just created) at a new-style location,
+// that's what's used, with the legacy vice.json left untouched.
+func TestResolveConfigPathPrefersNewLocation(t *testing.T) {
+	viceDir, _, home, _ := setupDirs(t)
+	old := configDir
+	defer func() { configDir = old }()
+
+	current := filepath.Join(viceDir, configFileName)
+	if err := os.WriteFile(current, []byte(`{"activePosition":"ZDV_CTR"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	legacy := filepath.Join(home, legacyConfigFileName)
+	if err := os.WriteFile(legacy, []byte(`{"activePosition":"stale"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	path, err := resolveConfigPath("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != current {
+		t.Errorf("resolveConfigPath(\"\") = %q, want %q", path, current)
+	}
+}
+
+// TestResolveConfigPathMigratesLegacyFile covers the case where nothing
+// matches any search path outright: the legacy vice.json should be
+// copied forward to the highest-priority directory.
+func TestResolveConfigPathMigratesLegacyFile(t *testing.T) {
+	viceDir, _, home, _ := setupDirs(t)
+	old := configDir
+	defer func() { configDir = old }()
+
+	legacy := filepath.Join(home, legacyConfigFileName)
+	contents := []byte(`{"activePosition":"ZAB_CTR"}`)
+	if err := os.WriteFile(legacy, contents, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Exercise migrateConfig directly, the way resolveConfigPath falls
+	// back to it once nothing in configSearchPaths() matched.
+	target := filepath.Join(viceDir, configFileName)
+	if err := migrateConfig(legacy, target); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(contents) {
+		t.Errorf("migrated config = %q, want %q", got, contents)
+	}
+
+	marker := target + migratedMarkerName
+	if _, err := os.Stat(marker); err != nil {
+		t.Errorf("expected migration marker at %q: %v", marker, err)
+	}
+
+	// A second call should be a no-op rather than re-copying.
+	if err := os.WriteFile(legacy, []byte(`{"activePosition":"changed"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := migrateConfig(legacy, target); err != nil {
+		t.Fatal(err)
+	}
+	got, err = os.ReadFile(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(contents) {
+		t.Errorf("second migrateConfig call overwrote target: got %q, want unchanged %q", got, contents)
+	}
+}
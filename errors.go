@@ -0,0 +1,52 @@
+// errors.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+// This file defines the sentinel errors that event handlers and modal
+// dialog callbacks use to ask the outer supervisor loop in main() to
+// tear down and re-initialize some or all of the running session,
+// rather than exiting the process outright. See requestSessionExit and
+// runSession in main.go.
+
+import "errors"
+
+var (
+	// ErrRestart asks the supervisor to tear down and re-create the
+	// current session from scratch, reusing the existing config. This
+	// is what a recovered panic offers as an alternative to quitting.
+	ErrRestart = errors.New("restart requested")
+
+	// ErrSwitchSectorFile asks the supervisor to restart the session
+	// after the user has picked a new sector or position file from
+	// Settings/Files..., so the new files are loaded on the way back
+	// up rather than requiring the user to quit and relaunch vice.
+	ErrSwitchSectorFile = errors.New("sector or position file changed")
+
+	// ErrReconnect asks the supervisor to restart the session and then
+	// immediately return to the connect screen, used when the network
+	// connection needs to be torn down and rebuilt (e.g., switching
+	// VATSIM regions).
+	ErrReconnect = errors.New("reconnect requested")
+
+	// ErrFatal indicates that the session cannot be recovered and the
+	// process should exit after this session's teardown completes.
+	ErrFatal = errors.New("fatal error")
+)
+
+// sessionExitErr is set by requestSessionExit and consulted by the
+// frame loop in runSession to decide when to stop running the current
+// session and, via its return value, what the supervisor in main()
+// should do next.
+var sessionExitErr error
+
+// requestSessionExit records that the current session should end with
+// the given sentinel error. It's called from the Restart/Quit buttons on
+// FatalErrorScreen and from runSession's per-frame check for sector,
+// position file, or position changes made via Settings/Files..., rather
+// than having those paths exit the process directly, so that main()'s
+// supervisor loop can decide whether to re-initialize or shut down.
+func requestSessionExit(err error) {
+	sessionExitErr = err
+}
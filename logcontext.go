@@ -0,0 +1,60 @@
+// logcontext.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+// This file defines LogContext, the subsystem tag that every call to
+// lg.Printf/lg.Errorf must now carry. Logger keeps a per-context
+// enable/verbosity map (seeded from GlobalConfig) and a per-context ring
+// buffer, so a user who's drowning in VATSIM packet traffic can silence
+// NetworkCtx while keeping RenderCtx warnings, and "please attach
+// vice.log" bug reports come back filterable by subsystem instead of as
+// one undifferentiated stream.
+
+// LogContext identifies the subsystem a log message comes from. It's
+// the first argument to every Logger method that actually records a
+// message.
+type LogContext int
+
+const (
+	// AlwaysCtx is for messages that should be recorded regardless of
+	// the per-context verbosity settings: startup/shutdown milestones,
+	// panics, and anything else a user would want even with every
+	// other context silenced.
+	AlwaysCtx LogContext = iota
+
+	// NetworkCtx covers VATSIM/ATCServer traffic: connects, disconnects,
+	// and individual packets when verbose.
+	NetworkCtx
+
+	// AudioCtx covers sound device initialization and playback.
+	AudioCtx
+
+	// RenderCtx covers the platform/renderer backends and the window
+	// manager's screen stack.
+	RenderCtx
+
+	// SimCtx covers aircraft simulation and the static database
+	// (sector file, position file, etc.) loading and updates.
+	SimCtx
+)
+
+// String returns the short name used for this context in log output
+// and in the -log-traffic-style verbosity flags.
+func (c LogContext) String() string {
+	switch c {
+	case AlwaysCtx:
+		return "always"
+	case NetworkCtx:
+		return "network"
+	case AudioCtx:
+		return "audio"
+	case RenderCtx:
+		return "render"
+	case SimCtx:
+		return "sim"
+	default:
+		return "unknown"
+	}
+}
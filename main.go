@@ -41,14 +41,26 @@ var (
 	controlUpdates *ControlUpdates
 	lg             *Logger
 
+	// resolvedConfigPath is the config file path chosen by
+	// resolveConfigPath in main(), passed to LoadOrMakeDefaultConfig
+	// each time a session is (re-)initialized.
+	resolvedConfigPath string
+
 	//go:embed resources/version.txt
 	buildVersion string
 
 	// Command-line options are only used for developer features.
-	logTraffic = flag.Bool("log-traffic", false, "log all network traffic")
-	cpuprofile = flag.String("cpuprofile", "", "write CPU profile to file")
-	memprofile = flag.String("memprofile", "", "write memory profile to this file")
-	devmode    = flag.Bool("devmode", false, "developer mode")
+	logTraffic           = flag.Bool("log-traffic", false, "log all network traffic")
+	cpuprofile           = flag.String("cpuprofile", "", "write CPU profile to file")
+	memprofile           = flag.String("memprofile", "", "write memory profile to this file")
+	devmode              = flag.Bool("devmode", false, "developer mode")
+	headless             = flag.Bool("headless", false, "run without a GUI, driving a TerminalFrontend from stdin")
+	terminal             = flag.Bool("terminal", false, "alias for -headless")
+	scriptFile           = flag.String("script", "", "file of ATC commands to replay in -headless/-terminal mode, one per line")
+	metricsAddr          = flag.String("metrics-addr", "", "if set, serve Prometheus metrics at this address, e.g. :9090")
+	configFile           = flag.String("config", "", "path to the config file to use, overriding the usual search path")
+	printConfigPathsFlag = flag.Bool("print-config-paths", false, "print the config file search path and exit")
+	replayFile           = flag.String("replay", "", "path to a recorded trace file to replay instead of connecting to a live ATCServer")
 )
 
 func init() {
@@ -60,60 +72,136 @@ func init() {
 }
 
 func main() {
-	// Catch any panics so that we can put up a dialog box and hopefully
-	// get a bug report.
-	var context *imgui.Context
-	defer func() {
-		if err := recover(); err != nil {
-			lg.Errorf("Panic stack: %s", string(debug.Stack()))
-			ShowFatalErrorDialog("Unfortunately an unexpected error has occurred and vice is unable to recover.\n"+
-				"Apologies! Please do file a bug and include the vice.log file for this session\nso that "+
-				"this bug can be fixed.\n\nError: %v", err)
-		}
-		lg.SaveLogs()
-
-		// Clean up in backwards order from how things were created.
-		renderer.Dispose()
-		platform.Dispose()
-		context.Destroy()
-	}()
-
 	///////////////////////////////////////////////////////////////////////////
 	// Global initialization and set up. Note that there are some subtle
 	// inter-dependencies in the following; the order is carefully crafted.
 	flag.Parse()
 
-	// Initialize the logging system first and foremost.
+	if *printConfigPathsFlag {
+		printConfigPaths()
+		return
+	}
+
+	// Initialize the logging system first and foremost; it, unlike
+	// everything sessionInit sets up, lives for the lifetime of the
+	// process and is not recreated across restarts.
 	lg = NewLogger(true, *devmode, 50000)
+	if *logTraffic {
+		// -log-traffic is a preset over the per-context verbosity map:
+		// it's equivalent to flipping NetworkCtx to verbose without
+		// having to touch anything else a user has configured.
+		lg.SetVerbose(NetworkCtx, true)
+	}
+
+	var err error
+	resolvedConfigPath, err = resolveConfigPath(*configFile)
+	if err != nil {
+		lg.Errorf(AlwaysCtx, "unable to resolve config path: %v", err)
+	}
+
+	if *metricsAddr != "" {
+		metricsInit(*metricsAddr)
+	}
+
+	if *headless || *terminal {
+		// Skip imguiInit, NewGLFWPlatform, NewOpenGL2Renderer, and
+		// wmInit entirely: the headless path only ever pumps
+		// ATCServer/positionConfig updates against a TerminalFrontend.
+		database = InitializeStaticDatabase()
+		server = &DisconnectedATCServer{}
+		LoadOrMakeDefaultConfig(resolvedConfigPath)
+		globalConfig.MakeConfigActive(globalConfig.ActivePosition)
+		controlUpdates = NewControlUpdates()
+		terminalMain(*scriptFile)
+		return
+	}
 
 	if *cpuprofile != "" {
 		if f, err := os.Create(*cpuprofile); err != nil {
-			lg.Errorf("%s: unable to create CPU profile file: %v", *cpuprofile, err)
+			lg.Errorf(AlwaysCtx, "%s: unable to create CPU profile file: %v", *cpuprofile, err)
 		} else {
 			if err = pprof.StartCPUProfile(f); err != nil {
-				lg.Errorf("unable to start CPU profile: %v", err)
+				lg.Errorf(AlwaysCtx, "unable to start CPU profile: %v", err)
 			} else {
 				defer pprof.StopCPUProfile()
 			}
 		}
 	}
 
-	context = imguiInit()
+	// Run sessions until one of them returns an error other than one of
+	// the restart sentinels: a graceful quit, or ErrFatal after the user
+	// declines to restart following a panic.
+	for {
+		err := runSession()
+		switch err {
+		case ErrRestart, ErrSwitchSectorFile, ErrReconnect:
+			lg.Printf(AlwaysCtx, "Restarting session: %v", err)
+			continue
+		case ErrFatal:
+			lg.Printf(AlwaysCtx, "Exiting after unrecoverable error: %v", err)
+		case nil:
+			lg.Printf(AlwaysCtx, "Exiting normally")
+		default:
+			lg.Errorf(AlwaysCtx, "Exiting after error: %v", err)
+		}
+		break
+	}
+
+	if *memprofile != "" {
+		f, err := os.Create(*memprofile)
+		if err != nil {
+			lg.Errorf(AlwaysCtx, "%s: unable to create memory profile file: %v", *memprofile, err)
+		}
+		if err = pprof.WriteHeapProfile(f); err != nil {
+			lg.Errorf(AlwaysCtx, "%s: unable to write memory profile file: %v", *memprofile, err)
+		}
+		f.Close()
+	}
+
+	if *devmode {
+		fmt.Print(lg.GetErrorLog())
+	}
+}
+
+// sessionContext collects the per-session state that sessionInit
+// creates and sessionDispose tears down: everything that restarting
+// (changing the sector file, reconnecting, recovering from a panic)
+// needs to rebuild from scratch, as opposed to the process-wide state
+// in the package-level globals like lg.
+type sessionContext struct {
+	imgui *imgui.Context
+
+	// sectorFile, positionFile, and activePosition are snapshotted once
+	// sessionInit has loaded the config, so that the per-frame check in
+	// runSession can tell when Settings/Files... (or any other code
+	// that mutates globalConfig at runtime) has changed them and ask
+	// for the matching sentinel-driven restart instead of silently
+	// running with half-applied config.
+	sectorFile, positionFile, activePosition string
+}
+
+// sessionInit performs the GL/imgui/audio/UI setup that used to live
+// directly in main(): everything that needs to be redone from scratch
+// when the supervisor loop in main() restarts the session.
+func sessionInit() (*sessionContext, error) {
+	sc := &sessionContext{imgui: imguiInit()}
 
 	database = InitializeStaticDatabase()
 	server = &DisconnectedATCServer{}
 
-	var err error
-	if err = audioInit(); err != nil {
-		lg.Errorf("Unable to initialize audio: %v", err)
+	if err := audioInit(); err != nil {
+		lg.Errorf(AudioCtx, "Unable to initialize audio: %v", err)
 	}
 
-	LoadOrMakeDefaultConfig()
+	LoadOrMakeDefaultConfig(resolvedConfigPath)
+	sc.sectorFile, sc.positionFile, sc.activePosition =
+		globalConfig.SectorFile, globalConfig.PositionFile, globalConfig.ActivePosition
 
 	// Avoid a flurry of sounds at the start, especially when we're
 	// replaying a trace with a time offset.
 	globalConfig.AudioSettings.MuteFor(3 * time.Second)
 
+	var err error
 	if true {
 		// Multisampling on Retina displays seems to hit a performance
 		// wall if the window is too large; lacking a better approach
@@ -130,7 +218,7 @@ func main() {
 			globalConfig.InitialWindowPosition)
 	}
 	if err != nil {
-		panic(fmt.Sprintf("Unable to create application window: %v", err))
+		return sc, fmt.Errorf("unable to create application window: %w", err)
 	}
 	imgui.CurrentIO().SetClipboard(platform.GetClipboard())
 
@@ -144,12 +232,14 @@ func main() {
 
 	// These will appear the first time vice is launched and the user
 	// hasn't yet set these up.  (And also if the chosen files are moved or
-	// deleted, etc...)
-	if database.LoadSectorFile(globalConfig.SectorFile) != nil {
+	// deleted, etc...)  Paths are resolved relative to the config file's
+	// own directory rather than the current working directory, so a
+	// config saved from one CWD still works when launched from another.
+	if database.LoadSectorFile(resolveConfigRelative(globalConfig.SectorFile)) != nil {
 		uiAddError("Unable to load sector file. Please specify a new one using Settings/Files...",
 			func() bool { return database.sectorFileLoadError == nil })
 	}
-	if database.LoadPositionFile(globalConfig.PositionFile) != nil {
+	if database.LoadPositionFile(resolveConfigRelative(globalConfig.PositionFile)) != nil {
 		uiAddError("Unable to load position file. Please specify a new one using Settings/Files...",
 			func() bool { return database.positionFileLoadError == nil })
 	}
@@ -160,118 +250,177 @@ func main() {
 
 	renderer, err = NewOpenGL2Renderer(imgui.CurrentIO())
 	if err != nil {
-		panic(fmt.Sprintf("Unable to initialize OpenGL: %v", err))
+		return sc, fmt.Errorf("unable to initialize OpenGL: %w", err)
 	}
 
 	uiInit(renderer)
 
 	controlUpdates = NewControlUpdates()
 
+	return sc, nil
+}
+
+// sessionDispose saves the logs and then tears down the renderer, the
+// platform window, and the imgui context that sessionInit set up, in
+// backwards order from how they were created. The audio set up by
+// audioInit is not released here.
+func sessionDispose(sc *sessionContext) {
+	lg.SaveLogs()
+
+	if renderer != nil {
+		renderer.Dispose()
+	}
+	if platform != nil {
+		platform.Dispose()
+	}
+	if sc.imgui != nil {
+		sc.imgui.Destroy()
+	}
+}
+
+// runSession runs sessionInit, the event loop, and sessionDispose for a
+// single session: one "life" of the GL window and ATC connection. It
+// returns nil after a normal user-initiated quit, the error from
+// sessionInit if setup fails, or the sentinel error from errors.go that
+// was passed to requestSessionExit, which tells the supervisor in main()
+// whether to start a fresh session or exit.
+func runSession() (exitErr error) {
+	sessionExitErr = nil
+
+	sc, err := sessionInit()
+	defer sessionDispose(sc)
+	if err != nil {
+		return err
+	}
+
+	// checkConfigChanged is called once a frame below; it's how
+	// Settings/Files... (or any other code that mutates globalConfig at
+	// runtime, out of this file's reach) asks for a graceful teardown
+	// and re-init instead of requiring the user to quit and relaunch.
+	checkConfigChanged := func() {
+		if globalConfig.SectorFile != sc.sectorFile || globalConfig.PositionFile != sc.positionFile {
+			requestSessionExit(ErrSwitchSectorFile)
+		} else if globalConfig.ActivePosition != sc.activePosition {
+			requestSessionExit(ErrReconnect)
+		}
+	}
+
 	///////////////////////////////////////////////////////////////////////////
 	// Main event / rendering loop
-	lg.Printf("Starting main loop")
+	//
+	// The loop itself just pumps network updates and then asks whatever
+	// Screen is on top of wmScreenStack to handle events and draw
+	// itself; what mode vice is in (splash, connect dialog, radar scope,
+	// replay, a modal dialog on top of any of those, ...) is entirely
+	// the stack's business, not the loop's.
+	lg.Printf(AlwaysCtx, "Starting main loop")
 	frameIndex := 0
-	wantExit := false
 	stats.startTime = time.Now()
+	wmScreenStack = nil
+	wmPushScreen(&SplashScreen{})
 	for {
-		platform.SetWindowTitle("vice: " + server.GetWindowTitle())
+		// Each frame gets its own panic recovery so that an error deep
+		// in a pane's Draw or in a screen's HandleEvent doesn't take
+		// the whole session down uncleanly: it's turned into a
+		// FatalErrorScreen offering Restart or Quit instead.
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					metricsRecordPanic()
+					lg.Errorf(AlwaysCtx, "Panic stack: %s", string(debug.Stack()))
+					wmPushScreen(&FatalErrorScreen{message: fmt.Sprintf(
+						"Unfortunately an unexpected error has occurred.\n"+
+							"Apologies! Please do file a bug and include the vice.log file\n"+
+							"for this session so that this bug can be fixed.\n\nError: %v", r)})
+				}
+			}()
 
-		// Inform imgui about input events from the user.
-		platform.ProcessEvents()
+			platform.SetWindowTitle("vice: " + server.GetWindowTitle())
 
-		stats.redraws++
+			// Inform imgui about input events from the user.
+			platform.ProcessEvents()
 
-		lastTime := time.Now()
-		timeMarker := func(d *time.Duration) {
-			now := time.Now()
-			*d = now.Sub(lastTime)
-			lastTime = now
-		}
+			stats.redraws++
 
-		// Let the world update its state based on messages from the
-		// network; a synopsis of changes to aircraft is then passed along
-		// to the window panes and the active positionConfig.
-		positionConfig.SendUpdates()
-		server.GetUpdates()
-		if !controlUpdates.NoUpdates() {
-			positionConfig.Update(controlUpdates)
-			wmShareUpdates(controlUpdates)
-			audioProcessUpdates(controlUpdates)
-
-			// Reset updates here since we may add new updates in the following
-			// draw calls that we'd like to have reported the next time around.
-			controlUpdates.Reset()
-		}
-		timeMarker(&stats.processMessages)
+			lastTime := time.Now()
+			timeMarker := func(d *time.Duration) {
+				now := time.Now()
+				*d = now.Sub(lastTime)
+				lastTime = now
+			}
 
-		platform.NewFrame()
-		imgui.NewFrame()
+			// Let the world update its state based on messages from the
+			// network; a synopsis of changes to aircraft is then passed along
+			// to the window panes and the active positionConfig.
+			positionConfig.SendUpdates()
+			server.GetUpdates()
+			if !controlUpdates.NoUpdates() {
+				positionConfig.Update(controlUpdates)
+				wmShareUpdates(controlUpdates)
+				audioProcessUpdates(controlUpdates)
+
+				// Reset updates here since we may add new updates in the following
+				// draw calls that we'd like to have reported the next time around.
+				controlUpdates.Reset()
+			}
+			timeMarker(&stats.processMessages)
+
+			// Settings/Files... runs as regular imgui UI code inside a
+			// screen's Draw, so it can only change globalConfig between
+			// frames; check here, right after the frame's update pass, for
+			// whether it asked for a new sector/position file or position
+			// to take effect.
+			checkConfigChanged()
+
+			// Give the active screen the chance to react to whatever changed
+			// above and to ShouldStop(); it may push a new screen, pop
+			// itself, or swap itself out for another.
+			if cur := wmCurrentScreen(); cur != nil {
+				if next := cur.HandleEvent(); next != cur {
+					wmPopScreen()
+					if next != nil {
+						wmPushScreen(next)
+					}
+				}
+			}
 
-		// Generate and render vice draw lists
-		wmDrawPanes(platform, renderer)
-		timeMarker(&stats.drawPanes)
+			platform.NewFrame()
+			imgui.NewFrame()
 
-		// Prepare our imgui draw lists
-		drawUI(positionConfig.GetColorScheme(), platform)
-		// Finalize and submit the imgui draw lists
-		imgui.Render()
-		renderer.RenderImgui(platform.DisplaySize(), platform.FramebufferSize(), imgui.RenderedDrawData())
-		timeMarker(&stats.drawImgui)
+			// Draw whatever screen is now on top of the stack.
+			if cur := wmCurrentScreen(); cur != nil {
+				cur.Draw(platform, renderer)
+			}
+			timeMarker(&stats.drawPanes)
 
-		// Wait for vsync
-		platform.PostRender()
+			// Finalize and submit the imgui draw lists
+			imgui.Render()
+			renderer.RenderImgui(platform.DisplaySize(), platform.FramebufferSize(), imgui.RenderedDrawData())
+			timeMarker(&stats.drawImgui)
 
-		// Periodically log current memory use, etc.
-		if (*devmode && frameIndex%600 == 0) || frameIndex%3600 == 0 {
-			lg.LogStats(stats)
-		}
-		frameIndex++
-
-		if platform.ShouldStop() {
-			if !wantExit {
-				wantExit = true
-
-				if server.Connected() {
-					uiShowModalDialog(NewModalDialogBox(&YesOrNoModalClient{
-						title: "Disconnect?",
-						query: "Currently connected. Ok to disconnect?",
-						ok: func() {
-							server.Disconnect()
-							server = &DisconnectedATCServer{}
-						},
-						notok: func() {
-							platform.CancelShouldStop()
-							wantExit = false
-						},
-					}), false)
-				}
+			// Wait for vsync
+			platform.PostRender()
 
-				// Grab assorted things that may have changed during this session.
-				globalConfig.ImGuiSettings = imgui.SaveIniSettingsToMemory()
-				globalConfig.InitialWindowSize = platform.WindowSize()
-				globalConfig.InitialWindowPosition = platform.WindowPosition()
+			metricsRecordFrame(stats)
 
-				// Do this while we're still running the event loop.
-				globalConfig.PromptToSaveIfChanged(renderer, platform)
-			} else if len(ui.activeModalDialogs) == 0 {
-				// good to go
-				break
+			// Periodically log current memory use, etc.
+			if (*devmode && frameIndex%600 == 0) || frameIndex%3600 == 0 {
+				lg.LogStats(stats)
 			}
-		}
-	}
+			frameIndex++
+		}()
 
-	if *memprofile != "" {
-		f, err := os.Create(*memprofile)
-		if err != nil {
-			lg.Errorf("%s: unable to create memory profile file: %v", *memprofile, err)
+		if sessionExitErr != nil && len(ui.activeModalDialogs) == 0 {
+			return sessionExitErr
 		}
-		if err = pprof.WriteHeapProfile(f); err != nil {
-			lg.Errorf("%s: unable to write memory profile file: %v", *memprofile, err)
-		}
-		f.Close()
-	}
 
-	if *devmode {
-		fmt.Print(lg.GetErrorLog())
+		// Once the screen stack empties out there's nothing left to draw
+		// or to handle events for: SaveConfigScreen pops itself once the
+		// save-prompt (if any) has been dismissed, which is the signal
+		// that this session is done and it's time to return to main()'s
+		// supervisor loop.
+		if wmCurrentScreen() == nil {
+			return nil
+		}
 	}
 }
@@ -0,0 +1,282 @@
+// screen.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+import "github.com/mmp/imgui-go/v4"
+
+// This file defines the Screen interface and the stack of Screens that
+// drives the top-level application flow. Rather than main() tracking an
+// assortment of booleans for "are we connected", "does the user want to
+// exit", "is a modal dialog up", each of those states is represented by
+// a Screen pushed onto the stack; only the screen on top is drawn and
+// given the chance to handle events, and it's up to that screen to push
+// further screens (e.g., a confirmation dialog) or pop itself off when
+// it's done.
+
+// Screen is the interface implemented by each of the top-level modes
+// vice can be in: the splash screen shown at startup, the connection
+// dialog, the main radar scope, replay playback, and so forth. Only the
+// screen at the top of the wmScreenStack is active at any given time.
+type Screen interface {
+	// Draw is called once per frame for the screen on top of the
+	// stack. It is responsible for issuing both vice's own draw lists
+	// (via wmDrawPanes, when applicable) and any imgui UI it needs.
+	Draw(platform Platform, renderer Renderer)
+
+	// HandleEvent gives the screen the chance to act on input and
+	// other state changes that occurred since the last frame. It
+	// returns the Screen that should be on top of the stack after the
+	// call: usually itself, but it may return a different Screen, which
+	// is popped into its place (a modal dialog that should return to it
+	// keeps a reference to it, as ConfirmDisconnectScreen does), or
+	// return nil to have itself popped.
+	HandleEvent() Screen
+
+	// Title returns a short human-readable name for the screen, used
+	// for the window title and in debugging output.
+	Title() string
+}
+
+// wmScreenStack holds the current stack of active Screens; the last
+// entry is the one that's drawn and updated each frame.
+var wmScreenStack []Screen
+
+// wmPushScreen pushes a new Screen on top of the stack, making it the
+// active one until it's popped or replaced.
+func wmPushScreen(s Screen) {
+	lg.Printf(RenderCtx, "pushing screen %q", s.Title())
+	wmScreenStack = append(wmScreenStack, s)
+}
+
+// wmPopScreen removes the topmost Screen from the stack. It is a no-op
+// if the stack is already empty.
+func wmPopScreen() {
+	if n := len(wmScreenStack); n > 0 {
+		lg.Printf(RenderCtx, "popping screen %q", wmScreenStack[n-1].Title())
+		wmScreenStack = wmScreenStack[:n-1]
+	}
+}
+
+// wmCurrentScreen returns the Screen on top of the stack, or nil if the
+// stack is empty (which should only happen momentarily, between the
+// last screen popping and main() deciding to exit).
+func wmCurrentScreen() Screen {
+	if n := len(wmScreenStack); n > 0 {
+		return wmScreenStack[n-1]
+	}
+	return nil
+}
+
+// SplashScreen is shown briefly at startup while the sector file,
+// position file, and other static data are loaded.
+type SplashScreen struct{}
+
+func (s *SplashScreen) Draw(platform Platform, renderer Renderer) {
+	drawSplashScreen()
+}
+
+func (s *SplashScreen) HandleEvent() Screen {
+	if database.SectorFileLoaded() && database.PositionFileLoaded() {
+		if *replayFile != "" {
+			return &ReplayScreen{TraceFile: *replayFile}
+		}
+		return &ConnectScreen{}
+	}
+	if platform.ShouldStop() {
+		return &SaveConfigScreen{}
+	}
+	return s
+}
+
+func (s *SplashScreen) Title() string { return "Splash" }
+
+// ConnectScreen shows the dialog the user connects to a VATSIM or
+// networked session from; it's also what's shown again after a
+// disconnect.
+type ConnectScreen struct{}
+
+func (s *ConnectScreen) Draw(platform Platform, renderer Renderer) {
+	drawConnectUI(platform)
+}
+
+func (s *ConnectScreen) HandleEvent() Screen {
+	if server.Connected() {
+		return &RadarScreen{}
+	}
+	if platform.ShouldStop() {
+		return &SaveConfigScreen{}
+	}
+	return s
+}
+
+func (s *ConnectScreen) Title() string { return "Connect" }
+
+// RadarScreen is the main scope: it's active for essentially all of a
+// normal controlling session.
+type RadarScreen struct{}
+
+func (s *RadarScreen) Draw(platform Platform, renderer Renderer) {
+	wmDrawPanes(platform, renderer)
+	drawUI(positionConfig.GetColorScheme(), platform)
+}
+
+func (s *RadarScreen) HandleEvent() Screen {
+	if !server.Connected() {
+		return &ConnectScreen{}
+	}
+	if platform.ShouldStop() {
+		return &ConfirmDisconnectScreen{under: s}
+	}
+	return s
+}
+
+func (s *RadarScreen) Title() string { return "Radar" }
+
+// ReplayScreen plays back a recorded trace instead of pulling updates
+// from a live ATCServer; it otherwise draws the same panes as
+// RadarScreen. It's reached from SplashScreen when vice is launched
+// with -replay, and from nowhere else yet: scrubbing controls and
+// picking a trace file interactively are left for a later pass.
+type ReplayScreen struct {
+	TraceFile string
+	started   bool
+}
+
+func (s *ReplayScreen) Draw(platform Platform, renderer Renderer) {
+	if !s.started {
+		s.started = true
+		server = NewReplayATCServer(s.TraceFile)
+	}
+	wmDrawPanes(platform, renderer)
+	drawUI(positionConfig.GetColorScheme(), platform)
+}
+
+func (s *ReplayScreen) HandleEvent() Screen {
+	if platform.ShouldStop() {
+		return &ConfirmDisconnectScreen{under: s}
+	}
+	return s
+}
+
+func (s *ReplayScreen) Title() string { return "Replay" }
+
+// ConfirmDisconnectScreen is pushed on top of RadarScreen or
+// ReplayScreen when the user asks to quit while connected; it draws the
+// screen underneath and then the "Disconnect?" modal on top of it. The
+// modal is only ever constructed once, the first time this screen is
+// drawn: uiShowModalDialog queues a dialog box rather than showing one
+// synchronously, so calling it again on every subsequent frame while
+// waiting for the user to answer would pile up a fresh dialog per
+// frame instead of reusing the one already on screen.
+type ConfirmDisconnectScreen struct {
+	under Screen
+	shown bool
+}
+
+func (s *ConfirmDisconnectScreen) Draw(platform Platform, renderer Renderer) {
+	s.under.Draw(platform, renderer)
+	if s.shown {
+		return
+	}
+	s.shown = true
+	uiShowModalDialog(NewModalDialogBox(&YesOrNoModalClient{
+		title: "Disconnect?",
+		query: "Currently connected. Ok to disconnect?",
+		ok: func() {
+			server.Disconnect()
+			server = &DisconnectedATCServer{}
+		},
+		notok: func() {
+			platform.CancelShouldStop()
+		},
+	}), false)
+}
+
+func (s *ConfirmDisconnectScreen) HandleEvent() Screen {
+	if !s.shown || len(ui.activeModalDialogs) != 0 {
+		return s
+	}
+	if platform.ShouldStop() {
+		// User confirmed: proceed to the save-config-and-quit screen.
+		return &SaveConfigScreen{}
+	}
+	// User said "no": go back to whatever was showing before.
+	return s.under
+}
+
+func (s *ConfirmDisconnectScreen) Title() string { return "ConfirmDisconnect" }
+
+// SaveConfigScreen is the last screen in the quit sequence: it snapshots
+// the window size/position/imgui layout into globalConfig and, if
+// anything's changed since it was last saved, prompts the user to save
+// it before the process exits. It's reached once vice has decided to
+// actually quit (as opposed to just disconnecting), from any of
+// SplashScreen, ConnectScreen, or ConfirmDisconnectScreen. Once its
+// prompt (if any) is dismissed, it pops itself; runSession treats an
+// empty screen stack as "done" and returns to the supervisor in main().
+type SaveConfigScreen struct {
+	shown bool
+}
+
+func (s *SaveConfigScreen) Draw(platform Platform, renderer Renderer) {
+	if s.shown {
+		return
+	}
+	s.shown = true
+
+	// Grab assorted things that may have changed during this session.
+	globalConfig.ImGuiSettings = imgui.SaveIniSettingsToMemory()
+	globalConfig.InitialWindowSize = platform.WindowSize()
+	globalConfig.InitialWindowPosition = platform.WindowPosition()
+
+	globalConfig.PromptToSaveIfChanged(renderer, platform)
+}
+
+func (s *SaveConfigScreen) HandleEvent() Screen {
+	if !s.shown || len(ui.activeModalDialogs) != 0 {
+		return s
+	}
+	// Popping this leaves the stack empty, which is runSession's signal
+	// to return and let the supervisor in main() decide what's next.
+	return nil
+}
+
+func (s *SaveConfigScreen) Title() string { return "SaveConfig" }
+
+// FatalErrorScreen is pushed on top of the current stack when a panic
+// has been recovered; its HandleEvent always returns itself, so it stays
+// the topmost screen and the screens under it are neither drawn nor
+// handed events again. Rather than exiting immediately, it offers
+// the user the choice of restarting the session via requestSessionExit
+// (ErrRestart) or quitting outright (ErrFatal). Like
+// ConfirmDisconnectScreen, the modal is only ever constructed the first
+// time this screen is drawn; gating on whether it's been shown (rather
+// than on whether it's been answered) is what keeps a fresh dialog from
+// being queued on every frame the user takes to respond.
+type FatalErrorScreen struct {
+	message string
+	shown   bool
+}
+
+func (s *FatalErrorScreen) Draw(platform Platform, renderer Renderer) {
+	if s.shown {
+		return
+	}
+	s.shown = true
+	uiShowModalDialog(NewModalDialogBox(&YesOrNoModalClient{
+		title: "Unexpected Error",
+		query: s.message + "\n\nWould you like to try to restart?",
+		ok: func() {
+			requestSessionExit(ErrRestart)
+		},
+		notok: func() {
+			requestSessionExit(ErrFatal)
+		},
+	}), false)
+}
+
+func (s *FatalErrorScreen) HandleEvent() Screen { return s }
+
+func (s *FatalErrorScreen) Title() string { return "FatalError" }
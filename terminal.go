@@ -0,0 +1,125 @@
+// terminal.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+// This file implements a text-only frontend for vice: it drives the
+// same ATCServer and positionConfig update path as the normal GUI, but
+// reads ATC commands from stdin (or a script file, via -script) instead
+// of mouse/keyboard input, and prints aircraft state to stdout instead
+// of rendering imgui. It's intended for recorded-traffic regression
+// tests, batch replay of bug reports, and running vice unattended on a
+// server.
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/mmp/imgui-go/v4"
+)
+
+// TerminalClipboard is a clipboard that never actually talks to the OS;
+// it's enough to satisfy imgui's IO.SetClipboard() when there's no
+// windowing system backing vice.
+type TerminalClipboard struct{ text string }
+
+func (c *TerminalClipboard) Text() string        { return c.text }
+func (c *TerminalClipboard) SetText(text string) { c.text = text }
+
+// TerminalFrontend reads commands from an input stream, one per line,
+// and prints a textual summary of the resulting world state after each
+// is processed. It implements both Platform and Renderer, standing in
+// for NewGLFWPlatform/NewOpenGL2Renderer when vice is run with
+// -headless or -terminal.
+type TerminalFrontend struct {
+	in        *bufio.Scanner
+	out       io.Writer
+	clipboard TerminalClipboard
+	shouldEnd bool
+}
+
+// NewTerminalFrontend creates a TerminalFrontend that reads commands
+// from in (stdin, or an open -script file) and writes output to out
+// (stdout).
+func NewTerminalFrontend(in io.Reader, out io.Writer) *TerminalFrontend {
+	return &TerminalFrontend{in: bufio.NewScanner(in), out: out}
+}
+
+// ProcessEvents reads the next available command line, if any, and
+// hands it off to the connected ATCServer. It blocks until a full line
+// (or end of input) is available, so nothing else in the headless loop
+// runs while it waits on stdin; once the scanner is exhausted (end of
+// script, or EOF on stdin) ShouldStop starts returning true.
+func (t *TerminalFrontend) ProcessEvents() {
+	if !t.in.Scan() {
+		t.shouldEnd = true
+		return
+	}
+
+	if line := t.in.Text(); line != "" {
+		if err := server.SendCommand(line); err != nil {
+			fmt.Fprintf(t.out, "%s: %v\n", line, err)
+		}
+	}
+}
+
+func (t *TerminalFrontend) ShouldStop() bool              { return t.shouldEnd }
+func (t *TerminalFrontend) CancelShouldStop()             { t.shouldEnd = false }
+func (t *TerminalFrontend) SetWindowTitle(s string)       {}
+func (t *TerminalFrontend) GetClipboard() imgui.Clipboard { return &t.clipboard }
+func (t *TerminalFrontend) NewFrame()                     {}
+func (t *TerminalFrontend) PostRender()                   {}
+func (t *TerminalFrontend) DisplaySize() [2]float32       { return [2]float32{80, 24} }
+func (t *TerminalFrontend) FramebufferSize() [2]float32   { return [2]float32{80, 24} }
+func (t *TerminalFrontend) WindowSize() [2]int            { return [2]int{80, 24} }
+func (t *TerminalFrontend) WindowPosition() [2]int        { return [2]int{0, 0} }
+func (t *TerminalFrontend) Dispose()                      {}
+
+// RenderImgui prints a terse textual summary of the current aircraft
+// state to stdout rather than submitting a draw list to the GPU.
+func (t *TerminalFrontend) RenderImgui(displaySize, framebufferSize [2]float32, drawData imgui.DrawData) {
+	for _, summary := range database.AircraftSummaries() {
+		fmt.Fprintln(t.out, summary)
+	}
+}
+
+// terminalMain runs the headless update loop: it skips imguiInit,
+// NewGLFWPlatform, NewOpenGL2Renderer, and wmInit entirely and instead
+// pumps ATCServer/positionConfig updates against a TerminalFrontend
+// until the input is exhausted. The ATCServer and positionConfig.Update
+// paths are unchanged from the GUI; only rendering is swapped out.
+func terminalMain(scriptPath string) {
+	var in io.Reader = os.Stdin
+	if scriptPath != "" {
+		f, err := os.Open(scriptPath)
+		if err != nil {
+			lg.Errorf(AlwaysCtx, "%s: unable to open script file: %v", scriptPath, err)
+			return
+		}
+		defer f.Close()
+		in = f
+	}
+
+	frontend := NewTerminalFrontend(in, os.Stdout)
+	platform = frontend
+	renderer = frontend
+
+	lg.Printf(AlwaysCtx, "Starting headless loop")
+	for !platform.ShouldStop() {
+		platform.ProcessEvents()
+
+		positionConfig.SendUpdates()
+		server.GetUpdates()
+		if !controlUpdates.NoUpdates() {
+			positionConfig.Update(controlUpdates)
+			controlUpdates.Reset()
+		}
+
+		renderer.RenderImgui(platform.DisplaySize(), platform.FramebufferSize(), imgui.DrawData{})
+	}
+
+	lg.Printf(AlwaysCtx, "Terminal frontend reached end of input; exiting")
+}